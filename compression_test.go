@@ -0,0 +1,68 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+type discardWriteCloser struct{}
+
+func (discardWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (discardWriteCloser) Close() error                { return nil }
+
+// benchmarkInsertWriter drives an InsertWriter through codec into a
+// discarding sink, to compare compressed vs. uncompressed dump throughput
+// for a representative table.
+func benchmarkInsertWriter(b *testing.B, codec CompressionCodec) {
+	table := &Table{Name: "bench", Columns: []string{"a", "b", "c"}}
+	row := []string{"'aaaaaaaaaaaaaaaaaaaa'", "123456789", "'2020-01-02T03:04:05.123456Z'"}
+
+	sink := CompressedSink(func(seq int) (io.WriteCloser, error) {
+		return discardWriteCloser{}, nil
+	}, codec)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := NewInsertWriter(table, sink, 0, 100)
+		for j := 0; j < 1000; j++ {
+			if err := w.Write(row); err != nil {
+				b.Fatalf("Write() error = %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatalf("Flush() error = %v", err)
+		}
+	}
+}
+
+func BenchmarkInsertWriterNoCompression(b *testing.B) {
+	benchmarkInsertWriter(b, CompressionNone)
+}
+
+func BenchmarkInsertWriterGzip(b *testing.B) {
+	benchmarkInsertWriter(b, CompressionGzip)
+}
+
+func BenchmarkInsertWriterZstd(b *testing.B) {
+	benchmarkInsertWriter(b, CompressionZstd)
+}
+
+func BenchmarkInsertWriterSnappy(b *testing.B) {
+	benchmarkInsertWriter(b, CompressionSnappy)
+}
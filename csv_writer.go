@@ -0,0 +1,166 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// CSVWriter writes table records as RFC 4180 delimited text (CRLF line
+// endings, fields quoted only when they need it), satisfying the Writer
+// interface alongside InsertWriter and UpdateWriter. It is meant for
+// loading a dump into BigQuery, Dataflow, or any other consumer that would
+// rather not parse generated INSERT statements.
+//
+// CSVWriter.Write itself only delimits and quotes; the Spanner-type-aware
+// encoding (BYTES/ARRAY/STRUCT/JSON as text or JSON, TIMESTAMP as RFC3339,
+// SQL NULL as the configured sentinel) happens once, up front, in
+// EncodeCSVRow - see csvLiteral in value.go. Feed Write with EncodeCSVRow's
+// output rather than a row already rendered as SQL literals, since the
+// SQL-literal quoting the other writers use (e.g. 'abc') would otherwise
+// end up embedded verbatim in the CSV field.
+type CSVWriter struct {
+	baseWriter
+
+	delimiter byte
+	quote     byte
+	header    bool
+}
+
+// CSVWriterOptions configures a CSVWriter/TSVWriter.
+type CSVWriterOptions struct {
+	// Delimiter separates fields on a line. Defaults to ',' for
+	// NewCSVWriter and '\t' for NewTSVWriter.
+	Delimiter byte
+	// Quote wraps fields that contain the delimiter, the quote byte, or
+	// a newline, doubling any quote bytes inside the field. Defaults to
+	// '"'.
+	Quote byte
+	// Header, if true, writes table.Columns as a header row at the start
+	// of every shard.
+	Header bool
+}
+
+// NewCSVWriter creates a CSVWriter for table, writing comma-separated
+// records through sink, sharded every threshold bytes (0 disables
+// sharding).
+func NewCSVWriter(table *Table, sink SinkFactory, threshold uint64, opts CSVWriterOptions) Writer {
+	return newDelimitedWriter(table, sink, threshold, ',', opts)
+}
+
+// NewTSVWriter creates a CSVWriter configured for tab-separated output.
+func NewTSVWriter(table *Table, sink SinkFactory, threshold uint64, opts CSVWriterOptions) Writer {
+	return newDelimitedWriter(table, sink, threshold, '\t', opts)
+}
+
+func newDelimitedWriter(table *Table, sink SinkFactory, threshold uint64, defaultDelimiter byte, opts CSVWriterOptions) Writer {
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		delimiter = defaultDelimiter
+	}
+	quote := opts.Quote
+	if quote == 0 {
+		quote = '"'
+	}
+
+	return &CSVWriter{
+		baseWriter: baseWriter{table: table, sink: sink, threshold: threshold},
+		delimiter:  delimiter,
+		quote:      quote,
+		header:     opts.Header,
+	}
+}
+
+// EncodeCSVRow decodes row into the CSV-ready string form CSVWriter.Write
+// expects, in table.Columns order: BYTES/ARRAY/STRUCT/JSON/TIMESTAMP
+// encoded per csvLiteral, and a SQL NULL column replaced by nullValue
+// (e.g. `\N`, matching mysqldump/dumpling) with no further quoting. A
+// non-NULL value equal to nullValue is also returned unchanged, so in the
+// output it cannot be told apart from an actual NULL.
+func EncodeCSVRow(row *spanner.Row, table *Table, nullValue string) ([]string, error) {
+	values := make([]string, len(table.Columns))
+	for i := range table.Columns {
+		var v spanner.GenericColumnValue
+		if err := row.Column(i, &v); err != nil {
+			return nil, fmt.Errorf("decode column %s of %s: %w", table.Columns[i], table.Name, err)
+		}
+		s, ok, err := csvLiteral(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode column %s of %s: %w", table.Columns[i], table.Name, err)
+		}
+		if !ok {
+			values[i] = nullValue
+			continue
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// Write writes a single record. If header is enabled, it re-emits
+// table.Columns as a header row at the start of every shard (including
+// after threshold rotation), so each shard is independently loadable.
+//
+// The header and the record are written to baseWriter.write as a single
+// string so threshold rotation - which baseWriter.write only applies
+// after a write returns - can't split them into a header-only shard
+// followed by a header-less one.
+func (w *CSVWriter) Write(values []string) error {
+	s := w.encodeRow(values)
+	if w.header && w.out == nil {
+		s = w.encodeRow(w.table.Columns) + s
+	}
+	return w.write(s)
+}
+
+func (w *CSVWriter) encodeRow(values []string) string {
+	sb := &strings.Builder{}
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteByte(w.delimiter)
+		}
+		sb.WriteString(w.encodeField(v))
+	}
+	sb.WriteString("\r\n") // RFC 4180 line ending
+	return sb.String()
+}
+
+func (w *CSVWriter) encodeField(v string) string {
+	if !w.needsQuoting(v) {
+		return v
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteByte(w.quote)
+	for i := 0; i < len(v); i++ {
+		if v[i] == w.quote {
+			sb.WriteByte(w.quote)
+		}
+		sb.WriteByte(v[i])
+	}
+	sb.WriteByte(w.quote)
+	return sb.String()
+}
+
+func (w *CSVWriter) needsQuoting(v string) bool {
+	return strings.IndexByte(v, w.delimiter) >= 0 ||
+		strings.IndexByte(v, w.quote) >= 0 ||
+		strings.ContainsAny(v, "\n\r")
+}
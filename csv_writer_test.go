@@ -0,0 +1,130 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+// bufferSink is a SinkFactory backed by in-memory buffers, one per shard,
+// for inspecting what each shard received.
+type bufferSink struct {
+	shards []*bytes.Buffer
+}
+
+func (s *bufferSink) factory() SinkFactory {
+	return func(seq int) (io.WriteCloser, error) {
+		buf := &bytes.Buffer{}
+		s.shards = append(s.shards, buf)
+		return closer{buf}, nil
+	}
+}
+
+type closer struct{ *bytes.Buffer }
+
+func (closer) Close() error { return nil }
+
+func TestCSVWriterEncodeField(t *testing.T) {
+	table := &Table{Name: "t", Columns: []string{"a", "b"}}
+	w := newDelimitedWriter(table, SingleSink(&bytes.Buffer{}), 0, ',', CSVWriterOptions{}).(*CSVWriter)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello", "hello"},
+		{"with comma", "a,b", `"a,b"`},
+		{"with quote", `a"b`, `"a""b"`},
+		{"with newline", "a\nb", "\"a\nb\""},
+		{"sentinel passthrough", `\N`, `\N`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.encodeField(tt.in); got != tt.want {
+				t.Errorf("encodeField(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVWriterCRLF(t *testing.T) {
+	table := &Table{Name: "t", Columns: []string{"a", "b"}}
+	buf := &bytes.Buffer{}
+	w := NewCSVWriter(table, SingleSink(buf), 0, CSVWriterOptions{})
+
+	if err := w.Write([]string{"1", "2"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if want := "1,2\r\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCSVWriterHeaderPerShard(t *testing.T) {
+	table := &Table{Name: "t", Columns: []string{"a", "b"}}
+	sink := &bufferSink{}
+	// Small threshold: every record rotates to a new shard.
+	w := NewCSVWriter(table, sink.factory(), 1, CSVWriterOptions{Header: true})
+
+	for i := 0; i < 3; i++ {
+		if err := w.Write([]string{"1", "2"}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if len(sink.shards) != 3 {
+		t.Fatalf("got %d shards, want 3", len(sink.shards))
+	}
+	for i, shard := range sink.shards {
+		if !strings.HasPrefix(shard.String(), "a,b\r\n") {
+			t.Errorf("shard %d = %q, want header prefix", i, shard.String())
+		}
+	}
+}
+
+func TestEncodeCSVRow(t *testing.T) {
+	table := &Table{Name: "t", Columns: []string{"id", "name"}}
+	row, err := spanner.NewRow([]string{"id", "name"}, []interface{}{int64(1), (*string)(nil)})
+	if err != nil {
+		t.Fatalf("spanner.NewRow() error = %v", err)
+	}
+
+	values, err := EncodeCSVRow(row, table, `\N`)
+	if err != nil {
+		t.Fatalf("EncodeCSVRow() error = %v", err)
+	}
+
+	want := []string{"1", `\N`}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("values[%d] = %q, want %q", i, values[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,412 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
+)
+
+// PKRangeStrategy selects how a table's primary-key space is partitioned
+// across ParallelDump workers.
+type PKRangeStrategy int
+
+const (
+	// PKRangeUniform splits the key space into ranges holding roughly the
+	// same number of rows, found by skipping to evenly spaced offsets in
+	// primary-key order.
+	PKRangeUniform PKRangeStrategy = iota
+	// PKRangeSample estimates range boundaries from a TABLESAMPLE query
+	// instead of counting rows, trading boundary precision for a much
+	// cheaper planning query on very large tables.
+	PKRangeSample
+)
+
+// ParallelDumpOptions configures ParallelDump.
+type ParallelDumpOptions struct {
+	// Threads is the number of worker goroutines, each with its own
+	// Writer, used to dump the table. Defaults to 1 if <= 0.
+	Threads int
+	// RowsPerBatch is the number of rows a worker reads from Spanner per
+	// batch before handing them to its Writer. Defaults to 1000 if <= 0.
+	RowsPerBatch int
+	// Strategy controls how the primary-key range is partitioned across
+	// workers. Ignored when Threads <= 1.
+	Strategy PKRangeStrategy
+}
+
+// pkRange is a half-open primary-key range [Low, High) assigned to a single
+// worker. A nil Low/High means "no lower/upper bound".
+type pkRange struct {
+	Low  interface{}
+	High interface{}
+}
+
+// rowBatch carries rows (or a terminal error) from a range's reader
+// goroutine to the worker goroutine that writes them.
+type rowBatch struct {
+	rows [][]string
+	err  error
+}
+
+// ParallelDump reads table concurrently from client, partitioning it by
+// primary key into at most opts.Threads ranges, and fans each range out to its own
+// Writer obtained from newWriter. This mirrors dumpling's -t/--threads
+// mode: every worker owns an independent Writer (baseWriter is documented
+// as not goroutine-safe), so callers must hand back a distinct Writer per
+// worker index rather than sharing one across goroutines. If any worker
+// fails, the rest are canceled via ctx and ParallelDump returns the first
+// error.
+func ParallelDump(ctx context.Context, client *spanner.Client, table *Table, opts ParallelDumpOptions, newWriter func(worker int) Writer) error {
+	threads := opts.Threads
+	if threads <= 0 {
+		threads = 1
+	}
+	rowsPerBatch := opts.RowsPerBatch
+	if rowsPerBatch <= 0 {
+		rowsPerBatch = 1000
+	}
+
+	ranges, err := partitionPrimaryKey(ctx, client, table, threads, opts.Strategy)
+	if err != nil {
+		return fmt.Errorf("partition primary key of %s: %w", table.Name, err)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for i, r := range ranges {
+		worker, r := i, r
+		g.Go(func() error {
+			w := newWriter(worker)
+			err := dumpRange(ctx, client, table, r, rowsPerBatch, w)
+			if flushErr := w.Flush(); err == nil {
+				err = flushErr
+			}
+			if err != nil {
+				return fmt.Errorf("worker %d (range %v): %w", worker, r, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// dumpRange reads all rows of table within r and writes them to w. Reading
+// happens on a separate goroutine so the writer is never blocked waiting on
+// the Spanner RPC for the next batch. On a write error, or if ctx is
+// canceled because a sibling range failed, the reader is canceled and its
+// remaining batches are drained so it never blocks on a full channel and
+// leaks.
+func dumpRange(ctx context.Context, client *spanner.Client, table *Table, r pkRange, rowsPerBatch int, w Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan rowBatch, 4)
+	go readPKRange(ctx, client, table, r, rowsPerBatch, batches)
+
+	var writeErr error
+	for b := range batches {
+		if writeErr != nil {
+			continue // draining: let the canceled reader close batches
+		}
+		if b.err != nil {
+			writeErr = b.err
+			cancel()
+			continue
+		}
+		for _, row := range b.rows {
+			if err := w.Write(row); err != nil {
+				writeErr = err
+				cancel()
+				break
+			}
+		}
+	}
+	return writeErr
+}
+
+// readPKRange queries table for the rows in r, batches them into groups of
+// rowsPerBatch and sends them to batches, closing it when done.
+func readPKRange(ctx context.Context, client *spanner.Client, table *Table, r pkRange, rowsPerBatch int, batches chan<- rowBatch) {
+	defer close(batches)
+
+	stmt := pkRangeStatement(table, r)
+	iter := client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	buf := make([][]string, 0, rowsPerBatch)
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			batches <- rowBatch{err: fmt.Errorf("query %s: %w", table.Name, err)}
+			return
+		}
+
+		values, err := stringifyRow(row, table)
+		if err != nil {
+			batches <- rowBatch{err: err}
+			return
+		}
+
+		buf = append(buf, values)
+		if len(buf) >= rowsPerBatch {
+			batches <- rowBatch{rows: buf}
+			buf = make([][]string, 0, rowsPerBatch)
+		}
+	}
+	if len(buf) > 0 {
+		batches <- rowBatch{rows: buf}
+	}
+}
+
+// stringifyRow decodes row into the same []string form Writer.Write
+// expects: one already-quoted-for-SQL literal per column, in table.Columns
+// order.
+func stringifyRow(row *spanner.Row, table *Table) ([]string, error) {
+	values := make([]string, len(table.Columns))
+	for i := range table.Columns {
+		var v spanner.GenericColumnValue
+		if err := row.Column(i, &v); err != nil {
+			return nil, fmt.Errorf("decode column %s of %s: %w", table.Columns[i], table.Name, err)
+		}
+		literal, err := sqlLiteral(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode column %s of %s: %w", table.Columns[i], table.Name, err)
+		}
+		values[i] = literal
+	}
+	return values, nil
+}
+
+// pkRangeStatement builds the "SELECT ... WHERE PK >= @lo AND PK < @hi"
+// query for r, omitting whichever bound is nil.
+func pkRangeStatement(table *Table, r pkRange) spanner.Statement {
+	params := map[string]interface{}{}
+
+	var conds []string
+	if r.Low != nil {
+		conds = append(conds, fmt.Sprintf("`%s` >= @lo", table.PrimaryKey))
+		params["lo"] = r.Low
+	}
+	if r.High != nil {
+		conds = append(conds, fmt.Sprintf("`%s` < @hi", table.PrimaryKey))
+		params["hi"] = r.High
+	}
+
+	sql := fmt.Sprintf("SELECT * FROM `%s`", table.Name)
+	if len(conds) > 0 {
+		sql += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	return spanner.Statement{SQL: sql, Params: params}
+}
+
+// partitionPrimaryKey splits table's primary-key space into at most threads
+// half-open ranges, one more than the number of boundaries pkBoundaries
+// finds. It returns a single unbounded range when threads <= 1.
+func partitionPrimaryKey(ctx context.Context, client *spanner.Client, table *Table, threads int, strategy PKRangeStrategy) ([]pkRange, error) {
+	if threads <= 1 {
+		return []pkRange{{}}, nil
+	}
+
+	boundaries, err := pkBoundaries(ctx, client, table, threads, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make([]pkRange, 0, len(boundaries)+1)
+	var low interface{}
+	for _, b := range boundaries {
+		ranges = append(ranges, pkRange{Low: low, High: b})
+		low = b
+	}
+	ranges = append(ranges, pkRange{Low: low})
+	return ranges, nil
+}
+
+// pkBoundaries returns up to threads-1 primary-key values that split table
+// into roughly equal ranges, in ascending order. It returns fewer (or none)
+// when the table is empty or too small to split.
+func pkBoundaries(ctx context.Context, client *spanner.Client, table *Table, threads int, strategy PKRangeStrategy) ([]interface{}, error) {
+	switch strategy {
+	case PKRangeSample:
+		return sampleBoundaries(ctx, client, table, threads)
+	default:
+		return uniformBoundaries(ctx, client, table, threads)
+	}
+}
+
+// uniformBoundaries counts table's rows, then for each of the threads-1
+// split points queries the primary-key value sitting at that offset in
+// primary-key order.
+func uniformBoundaries(ctx context.Context, client *spanner.Client, table *Table, threads int) ([]interface{}, error) {
+	count, err := rowCount(ctx, client, table)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	boundaries := make([]interface{}, 0, threads-1)
+	for i := 1; i < threads; i++ {
+		offset := count * int64(i) / int64(threads)
+		stmt := spanner.Statement{
+			SQL: fmt.Sprintf("SELECT `%s` FROM `%s` ORDER BY `%s` LIMIT 1 OFFSET @offset",
+				table.PrimaryKey, table.Name, table.PrimaryKey),
+			Params: map[string]interface{}{"offset": offset},
+		}
+		v, err := readSinglePK(ctx, client, stmt)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			break // fewer distinct rows than expected; stop splitting early
+		}
+		boundaries = append(boundaries, v)
+	}
+	return boundaries, nil
+}
+
+// sampleBoundaries draws a TABLESAMPLE of primary keys and picks threads-1
+// evenly spaced values from the sorted sample as range boundaries. This
+// avoids the COUNT(*) and per-boundary OFFSET scans uniformBoundaries needs,
+// at the cost of less even shards.
+func sampleBoundaries(ctx context.Context, client *spanner.Client, table *Table, threads int) ([]interface{}, error) {
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(
+			"SELECT `%s` FROM `%s` TABLESAMPLE BERNOULLI (10 PERCENT) ORDER BY `%s`",
+			table.PrimaryKey, table.Name, table.PrimaryKey),
+	}
+
+	iter := client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var sample []interface{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sample %s: %w", table.Name, err)
+		}
+		var v spanner.GenericColumnValue
+		if err := row.Column(0, &v); err != nil {
+			return nil, fmt.Errorf("decode sample of %s: %w", table.Name, err)
+		}
+		pk, err := decodePK(v)
+		if err != nil {
+			return nil, fmt.Errorf("decode sample of %s: %w", table.Name, err)
+		}
+		sample = append(sample, pk)
+	}
+	if len(sample) < threads {
+		return nil, nil // too small a sample to split meaningfully
+	}
+
+	boundaries := make([]interface{}, 0, threads-1)
+	for i := 1; i < threads; i++ {
+		boundaries = append(boundaries, sample[len(sample)*i/threads])
+	}
+	return boundaries, nil
+}
+
+func rowCount(ctx context.Context, client *spanner.Client, table *Table) (int64, error) {
+	stmt := spanner.Statement{SQL: fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table.Name)}
+	iter := client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", table.Name, err)
+	}
+	var count int64
+	if err := row.Column(0, &count); err != nil {
+		return 0, fmt.Errorf("decode count of %s: %w", table.Name, err)
+	}
+	return count, nil
+}
+
+// readSinglePK runs stmt, which must select exactly one primary-key column,
+// and returns its decoded value, or nil if the query has no rows.
+func readSinglePK(ctx context.Context, client *spanner.Client, stmt spanner.Statement) (interface{}, error) {
+	iter := client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	row, err := iter.Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read primary key boundary: %w", err)
+	}
+	var v spanner.GenericColumnValue
+	if err := row.Column(0, &v); err != nil {
+		return nil, fmt.Errorf("decode primary key boundary: %w", err)
+	}
+	return decodePK(v)
+}
+
+// decodePK decodes v into the concrete Go type matching its Spanner type,
+// so it can be bound as a query parameter later (spanner.GenericColumnValue
+// itself is decode-only and is rejected as a parameter value).
+func decodePK(v spanner.GenericColumnValue) (interface{}, error) {
+	if v.Type == nil {
+		return nil, fmt.Errorf("missing type information for primary key value")
+	}
+
+	switch v.Type.Code {
+	case sppb.TypeCode_STRING:
+		var s string
+		err := v.Decode(&s)
+		return s, err
+	case sppb.TypeCode_INT64:
+		var n int64
+		err := v.Decode(&n)
+		return n, err
+	case sppb.TypeCode_FLOAT64:
+		var f float64
+		err := v.Decode(&f)
+		return f, err
+	case sppb.TypeCode_BYTES:
+		var b []byte
+		err := v.Decode(&b)
+		return b, err
+	case sppb.TypeCode_TIMESTAMP:
+		var t time.Time
+		err := v.Decode(&t)
+		return t, err
+	case sppb.TypeCode_DATE:
+		var d civil.Date
+		err := v.Decode(&d)
+		return d, err
+	default:
+		return nil, fmt.Errorf("unsupported primary key type %s", v.Type.Code)
+	}
+}
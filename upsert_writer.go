@@ -0,0 +1,145 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UpsertMode selects the Spanner statement verb UpsertWriter emits.
+type UpsertMode int
+
+const (
+	// UpsertModeUpdate emits "INSERT OR UPDATE INTO", overwriting any row
+	// with a conflicting primary key.
+	UpsertModeUpdate UpsertMode = iota
+	// UpsertModeIgnore emits "INSERT OR IGNORE INTO", leaving any row
+	// with a conflicting primary key untouched.
+	UpsertModeIgnore
+)
+
+func (m UpsertMode) verb() string {
+	if m == UpsertModeIgnore {
+		return "INSERT OR IGNORE INTO"
+	}
+	return "INSERT OR UPDATE INTO"
+}
+
+// UpsertWriter writes table records in bulk using Spanner's "INSERT OR
+// UPDATE INTO"/"INSERT OR IGNORE INTO" statements, so a dump can be
+// replayed against a partially populated destination (resuming a failed
+// restore, topping up a staging environment) without primary-key
+// conflicts. It batches rows the same way InsertWriter does.
+type UpsertWriter struct {
+	baseWriter
+	buffer   [][]string
+	bulkSize uint
+	mode     UpsertMode
+}
+
+// NewUpsertWriter creates UpsertWriter with specified configs.
+func NewUpsertWriter(table *Table, sink SinkFactory, threshold uint64, bulkSize uint, mode UpsertMode) Writer {
+	return &UpsertWriter{
+		baseWriter: baseWriter{table: table, sink: sink, threshold: threshold},
+		buffer:     make([][]string, 0, bulkSize),
+		bulkSize:   bulkSize,
+		mode:       mode,
+	}
+}
+
+// Write writes a single record into the buffer. If buffer becomes full, it is flushed.
+func (w *UpsertWriter) Write(values []string) error {
+	w.buffer = append(w.buffer, values)
+	if len(w.buffer) >= int(w.bulkSize) {
+		return w.flushInUpsert()
+	}
+	return nil
+}
+
+// Flush flushes the buffered records and finalizes the current shard.
+func (w *UpsertWriter) Flush() error {
+	if len(w.buffer) > 0 {
+		if err := w.flushInUpsert(); err != nil {
+			return err
+		}
+	}
+	return w.baseWriter.Flush()
+}
+
+// flushInUpsert flushes the buffered records in a bulk upsert statement.
+func (w *UpsertWriter) flushInUpsert() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	quotedColumns := w.table.quotedColumnList()
+
+	// Calculate the size of buffer for strings.Builder
+	n := len(w.buffer) * 2 // 2 is for value separator (", ")
+	n += len(quotedColumns)
+	n += 100 // 100 is for remained statement ("INSERT OR UPDATE INTO ...")
+	for i := 0; i < len(w.buffer); i++ {
+		n += len(w.buffer[i])
+	}
+
+	// Use strings.Builder to avoid string being copied to build the statement
+	sb := &strings.Builder{}
+	sb.Grow(n)
+	sb.WriteString(w.mode.verb())
+	sb.WriteString(" `")
+	sb.WriteString(w.table.Name)
+	sb.WriteString("` (")
+	sb.WriteString(quotedColumns)
+	sb.WriteString(") VALUES ")
+	for i, b := range w.buffer {
+		sb.WriteString(fmt.Sprintf("(%s)", strings.Join(b, ", ")))
+		if i < (len(w.buffer) - 1) {
+			sb.WriteString(", ")
+		}
+	}
+	sb.WriteString(";\n")
+
+	err := w.write(sb.String())
+	w.buffer = w.buffer[:0]
+	return err
+}
+
+// ParseStatementMode maps a --statement-mode flag value ("insert", "upsert",
+// "ignore", or "update") to the Writer constructor it selects.
+func ParseStatementMode(mode string) (func(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer, error) {
+	switch mode {
+	case "", "insert":
+		return func(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer {
+			return NewInsertWriter(table, sink, threshold, bulkSize)
+		}, nil
+	case "upsert":
+		return func(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer {
+			return NewUpsertWriter(table, sink, threshold, bulkSize, UpsertModeUpdate)
+		}, nil
+	case "ignore":
+		return func(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer {
+			return NewUpsertWriter(table, sink, threshold, bulkSize, UpsertModeIgnore)
+		}, nil
+	case "update":
+		return func(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer {
+			return NewUpdateWriter(table, sink, threshold, nil)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown statement mode %q", mode)
+	}
+}
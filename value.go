@@ -0,0 +1,159 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// isNullValue reports whether v holds Spanner's SQL NULL.
+func isNullValue(v spanner.GenericColumnValue) bool {
+	if v.Value == nil || v.Value.GetKind() == nil {
+		return true
+	}
+	_, isNull := v.Value.GetKind().(*structpb.Value_NullValue)
+	return isNull
+}
+
+// sqlLiteral renders a decoded Spanner column value as the SQL literal
+// InsertWriter, UpdateWriter and UpsertWriter embed directly into their
+// statements. It is the single place that turns a spanner.GenericColumnValue
+// into dump output, so every statement-based Writer stays consistent.
+func sqlLiteral(v spanner.GenericColumnValue) (string, error) {
+	if isNullValue(v) {
+		return "NULL", nil
+	}
+	if v.Type == nil {
+		return "", fmt.Errorf("missing type information for value %v", v.Value)
+	}
+
+	switch v.Type.Code {
+	case sppb.TypeCode_BOOL:
+		return strconv.FormatBool(v.Value.GetBoolValue()), nil
+	case sppb.TypeCode_INT64, sppb.TypeCode_NUMERIC:
+		// Spanner encodes INT64/NUMERIC as a StringValue on the wire to
+		// avoid precision loss; the digits themselves need no quoting.
+		return v.Value.GetStringValue(), nil
+	case sppb.TypeCode_FLOAT64:
+		return formatFloat(v.Value), nil
+	case sppb.TypeCode_STRING, sppb.TypeCode_DATE, sppb.TypeCode_TIMESTAMP, sppb.TypeCode_JSON, sppb.TypeCode_BYTES:
+		return quoteSQLString(v.Value.GetStringValue()), nil
+	case sppb.TypeCode_ARRAY:
+		s, err := arrayJSON(v)
+		if err != nil {
+			return "", err
+		}
+		return quoteSQLString(s), nil
+	default:
+		return "", fmt.Errorf("unsupported column type %s", v.Type.Code)
+	}
+}
+
+// csvLiteral renders a decoded Spanner column value as CSV-ready text: no
+// SQL quoting, BYTES left as the base64 text Spanner already returns it as,
+// ARRAY/STRUCT as JSON, and TIMESTAMP normalized to RFC 3339. NULL is
+// reported via ok=false so callers can substitute their own null sentinel
+// instead of colliding with a legitimate "NULL" string value.
+func csvLiteral(v spanner.GenericColumnValue) (value string, ok bool, err error) {
+	if isNullValue(v) {
+		return "", false, nil
+	}
+	if v.Type == nil {
+		return "", true, fmt.Errorf("missing type information for value %v", v.Value)
+	}
+
+	switch v.Type.Code {
+	case sppb.TypeCode_BOOL:
+		return strconv.FormatBool(v.Value.GetBoolValue()), true, nil
+	case sppb.TypeCode_INT64, sppb.TypeCode_NUMERIC, sppb.TypeCode_STRING, sppb.TypeCode_DATE, sppb.TypeCode_BYTES, sppb.TypeCode_JSON:
+		return v.Value.GetStringValue(), true, nil
+	case sppb.TypeCode_FLOAT64:
+		return formatFloat(v.Value), true, nil
+	case sppb.TypeCode_TIMESTAMP:
+		t, err := time.Parse(time.RFC3339Nano, v.Value.GetStringValue())
+		if err != nil {
+			return "", true, fmt.Errorf("parse timestamp %q: %w", v.Value.GetStringValue(), err)
+		}
+		return t.UTC().Format(time.RFC3339Nano), true, nil
+	case sppb.TypeCode_ARRAY, sppb.TypeCode_STRUCT:
+		s, err := arrayJSON(v)
+		if err != nil {
+			return "", true, err
+		}
+		return s, true, nil
+	default:
+		return "", true, fmt.Errorf("unsupported column type %s", v.Type.Code)
+	}
+}
+
+// formatFloat renders a Spanner FLOAT64, which arrives as a NumberValue
+// except for the special values NaN/Infinity/-Infinity, which Spanner
+// encodes as a StringValue.
+func formatFloat(val *structpb.Value) string {
+	if s, ok := val.GetKind().(*structpb.Value_StringValue); ok {
+		return s.StringValue
+	}
+	return strconv.FormatFloat(val.GetNumberValue(), 'g', -1, 64)
+}
+
+// arrayJSON renders an ARRAY or STRUCT value as JSON.
+func arrayJSON(v spanner.GenericColumnValue) (string, error) {
+	b, err := json.Marshal(v.Value.AsInterface())
+	if err != nil {
+		return "", fmt.Errorf("encode %s value as JSON: %w", v.Type.Code, err)
+	}
+	return string(b), nil
+}
+
+// quoteSQLString escapes s for embedding in a single-quoted GoogleSQL
+// string literal and wraps it in single quotes. Besides backslashes and
+// single quotes, it backslash-escapes newlines, carriage returns, tabs
+// and NUL (as mysqldump does), since GoogleSQL single-quoted literals
+// cannot contain a raw newline and any other control byte would make the
+// dumped statement unreplayable.
+func quoteSQLString(s string) string {
+	sb := &strings.Builder{}
+	sb.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case 0:
+			sb.WriteString(`\0`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
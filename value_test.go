@@ -0,0 +1,130 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func gcv(code sppb.TypeCode, elem sppb.TypeCode, kind structpb.Value_Kind) spanner.GenericColumnValue {
+	typ := &sppb.Type{Code: code}
+	if code == sppb.TypeCode_ARRAY {
+		typ.ArrayElementType = &sppb.Type{Code: elem}
+	}
+	return spanner.GenericColumnValue{Type: typ, Value: &structpb.Value{Kind: kind}}
+}
+
+func stringGCV(code sppb.TypeCode, s string) spanner.GenericColumnValue {
+	return gcv(code, 0, &structpb.Value_StringValue{StringValue: s})
+}
+
+func nullGCV(code sppb.TypeCode) spanner.GenericColumnValue {
+	return gcv(code, 0, &structpb.Value_NullValue{})
+}
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		name string
+		v    spanner.GenericColumnValue
+		want string
+	}{
+		{"null", nullGCV(sppb.TypeCode_STRING), "NULL"},
+		{"bool", gcv(sppb.TypeCode_BOOL, 0, &structpb.Value_BoolValue{BoolValue: true}), "true"},
+		{"int64", stringGCV(sppb.TypeCode_INT64, "123"), "123"},
+		{"float64", gcv(sppb.TypeCode_FLOAT64, 0, &structpb.Value_NumberValue{NumberValue: 1.5}), "1.5"},
+		{"float64 NaN", stringGCV(sppb.TypeCode_FLOAT64, "NaN"), "NaN"},
+		{"string", stringGCV(sppb.TypeCode_STRING, "it's"), `'it\'s'`},
+		{"string with backslash", stringGCV(sppb.TypeCode_STRING, `a\b`), `'a\\b'`},
+		{"string with control bytes", stringGCV(sppb.TypeCode_STRING, "a\nb\rc\td\x00e"), `'a\nb\rc\td\0e'`},
+		{"bytes", stringGCV(sppb.TypeCode_BYTES, "YWJj"), "'YWJj'"},
+		{"timestamp", stringGCV(sppb.TypeCode_TIMESTAMP, "2020-01-02T03:04:05Z"), "'2020-01-02T03:04:05Z'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqlLiteral(tt.v)
+			if err != nil {
+				t.Fatalf("sqlLiteral() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sqlLiteral() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       spanner.GenericColumnValue
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{"null", nullGCV(sppb.TypeCode_STRING), "", false, false},
+		{"int64", stringGCV(sppb.TypeCode_INT64, "123"), "123", true, false},
+		{"string untouched", stringGCV(sppb.TypeCode_STRING, "it's"), "it's", true, false},
+		{"bytes passthrough base64", stringGCV(sppb.TypeCode_BYTES, "YWJj"), "YWJj", true, false},
+		{"timestamp normalized", stringGCV(sppb.TypeCode_TIMESTAMP, "2020-01-02T03:04:05.5Z"), "2020-01-02T03:04:05.5Z", true, false},
+		{"timestamp invalid", stringGCV(sppb.TypeCode_TIMESTAMP, "not-a-time"), "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := csvLiteral(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("csvLiteral() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ok != tt.wantOK {
+				t.Errorf("csvLiteral() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("csvLiteral() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVLiteralArray(t *testing.T) {
+	v := spanner.GenericColumnValue{
+		Type: &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: sppb.TypeCode_INT64}},
+		Value: &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{
+			Values: []*structpb.Value{
+				{Kind: &structpb.Value_NumberValue{NumberValue: 1}},
+				{Kind: &structpb.Value_NumberValue{NumberValue: 2}},
+			},
+		}}},
+	}
+
+	got, ok, err := csvLiteral(v)
+	if err != nil {
+		t.Fatalf("csvLiteral() error = %v", err)
+	}
+	if !ok {
+		t.Fatalf("csvLiteral() ok = false, want true")
+	}
+	if want := "[1,2]"; got != want {
+		t.Errorf("csvLiteral() = %q, want %q", got, want)
+	}
+}
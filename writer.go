@@ -17,22 +17,58 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 )
 
 type Writer interface {
-	Write(values []string)
-	Flush()
+	Write(values []string) error
+	Flush() error
 }
 
+// SinkFactory returns the io.WriteCloser backing the seq'th output shard
+// (seq starts at 1). It is called lazily, once per shard, the first time
+// a writer needs to emit a statement into it.
+type SinkFactory func(seq int) (io.WriteCloser, error)
+
+// SingleSink adapts a plain io.Writer into a SinkFactory that always returns
+// out and never closes it, for callers that don't need sharding.
+func SingleSink(out io.Writer) SinkFactory {
+	return func(seq int) (io.WriteCloser, error) {
+		return nopWriteCloser{out}, nil
+	}
+}
+
+// FileShardSink returns a SinkFactory that writes each shard to its own
+// file named "<baseName>.<seq>.sql", the sequence number zero-padded to
+// four digits (e.g. table.0001.sql, table.0002.sql, ...).
+func FileShardSink(baseName string) SinkFactory {
+	return func(seq int) (io.WriteCloser, error) {
+		return os.Create(fmt.Sprintf("%s.%04d.sql", baseName, seq))
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
 // baseWriter is a writer to write table records in bulk.
 //
 // NOTE: baseWriter is not goroutine-safe.
 type baseWriter struct {
-	out   io.Writer
-	table *Table
+	table     *Table
+	sink      SinkFactory
+	threshold uint64 // shard is closed once it reaches this many bytes; 0 disables sharding
+
+	out     io.WriteCloser
+	buf     *bufio.Writer
+	seq     int
+	written uint64
 }
 
 type InsertWriter struct {
@@ -46,12 +82,17 @@ type UpdateWriter struct {
 	columns []string
 }
 
-// NewInsertWriter creates InsertWrite with specified configs.
-func NewInsertWriter(table *Table, out io.Writer, bulkSize uint) Writer {
+// NewInsertWriter creates InsertWriter with specified configs. sink supplies
+// the output shards; threshold is the number of bytes at which a shard is
+// closed, after the statement that reaches it, so the next statement is
+// routed to a new one (0 disables sharding, so everything goes to the
+// single shard returned by sink).
+func NewInsertWriter(table *Table, sink SinkFactory, threshold uint64, bulkSize uint) Writer {
 	return &InsertWriter{
 		baseWriter: baseWriter{
-			out:   out,
-			table: table,
+			table:     table,
+			sink:      sink,
+			threshold: threshold,
 		},
 
 		buffer:   make([][]string, 0, bulkSize),
@@ -59,34 +100,90 @@ func NewInsertWriter(table *Table, out io.Writer, bulkSize uint) Writer {
 	}
 }
 
-// Flush flushes the buffered records.
-func (w *baseWriter) Flush() {
+// Flush flushes the buffered bytes to the current output shard and closes
+// it. It must be called once writing is done so the last shard is
+// finalized.
+func (w *baseWriter) Flush() error {
+	return w.closeShard()
 }
 
 // Write writes a single record into the buffer. If buffer becomes full, it is flushed.
-func (w *InsertWriter) Write(values []string) {
+func (w *InsertWriter) Write(values []string) error {
 	w.buffer = append(w.buffer, values)
 	if len(w.buffer) >= int(w.bulkSize) {
-		w.Flush()
+		return w.flushInInsert()
 	}
+	return nil
 }
 
-// Flush flushes the buffered records.
-func (w *InsertWriter) Flush() {
-	if len(w.buffer) == 0 {
-		return
+// Flush flushes the buffered records and finalizes the current shard.
+func (w *InsertWriter) Flush() error {
+	if len(w.buffer) > 0 {
+		if err := w.flushInInsert(); err != nil {
+			return err
+		}
 	}
-	w.flushInInsert()
+	return w.baseWriter.Flush()
 }
 
 func (w *baseWriter) quote(column string) string {
 	return fmt.Sprintf("`%s`", column)
 }
 
-// Flush flushes the buffered records in insert statement
-func (w *InsertWriter) flushInInsert() {
+// write emits s to the current shard, opening the first/next shard as
+// needed, and rotates to a new shard once the current one has grown past
+// threshold. Rotation only happens between statements, so every shard
+// starts with a complete statement and is independently replayable.
+func (w *baseWriter) write(s string) error {
+	if w.out == nil {
+		if err := w.openShard(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.buf.WriteString(s); err != nil {
+		return fmt.Errorf("write to output shard %d: %w", w.seq, err)
+	}
+	w.written += uint64(len(s))
+	if w.threshold > 0 && w.written >= w.threshold {
+		return w.closeShard()
+	}
+	return nil
+}
+
+func (w *baseWriter) openShard() error {
+	w.seq++
+	out, err := w.sink(w.seq)
+	if err != nil {
+		return fmt.Errorf("open output shard %d: %w", w.seq, err)
+	}
+	w.out = out
+	w.buf = bufio.NewWriter(out)
+	w.written = 0
+	return nil
+}
+
+func (w *baseWriter) closeShard() error {
+	if w.out == nil {
+		return nil
+	}
+	out, buf := w.out, w.buf
+	w.out, w.buf = nil, nil
+
+	flushErr := buf.Flush()
+	closeErr := out.Close()
+	if flushErr != nil {
+		return fmt.Errorf("flush output shard %d: %w", w.seq, flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close output shard %d: %w", w.seq, closeErr)
+	}
+	return nil
+}
+
+// flushInInsert flushes the buffered records in an insert statement.
+func (w *InsertWriter) flushInInsert() error {
 	if len(w.buffer) == 0 {
-		return
+		return nil
 	}
 
 	quotedColumns := w.table.quotedColumnList()
@@ -115,8 +212,9 @@ func (w *InsertWriter) flushInInsert() {
 	}
 	sb.WriteString(";\n")
 
-	fmt.Fprint(w.out, sb.String())
+	err := w.write(sb.String())
 	w.buffer = w.buffer[:0]
+	return err
 }
 
 func (w *baseWriter) findColumnValue(values []string, primaryKey string) string {
@@ -128,12 +226,14 @@ func (w *baseWriter) findColumnValue(values []string, primaryKey string) string
 	panic("not primary key value found")
 }
 
-// NewUpdateWriter creates InsertWrite with specified configs.
-func NewUpdateWriter(table *Table, out io.Writer, columns []string) Writer {
+// NewUpdateWriter creates UpdateWriter with specified configs. sink and
+// threshold behave the same as for NewInsertWriter.
+func NewUpdateWriter(table *Table, sink SinkFactory, threshold uint64, columns []string) Writer {
 	return &UpdateWriter{
 		baseWriter: baseWriter{
-			out:   out,
-			table: table,
+			table:     table,
+			sink:      sink,
+			threshold: threshold,
 		},
 		columns: columns,
 	}
@@ -147,7 +247,10 @@ func (w *UpdateWriter) Columns() []string {
 	return columns
 }
 
-func (w *UpdateWriter) Write(values []string) {
+// Write writes a single record as its own UPDATE statement through the
+// shared buffered sink, so single-row-per-statement mode stays fast even
+// against a high-latency output destination.
+func (w *UpdateWriter) Write(values []string) error {
 
 	// Use strings.Builder to avoid string being copied to build INSERT statement
 	sb := &strings.Builder{}
@@ -173,7 +276,7 @@ func (w *UpdateWriter) Write(values []string) {
 
 	sb.WriteString(";\n")
 
-	fmt.Fprint(w.out, sb.String())
+	return w.write(sb.String())
 }
 func (w *UpdateWriter) quotedColumnList() []string {
 	columns := w.columns